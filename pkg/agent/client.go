@@ -5,15 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
-	"strconv"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/azazeal/pause"
 	"github.com/blang/semver"
 	"github.com/pkg/errors"
 
+	"google.golang.org/grpc"
+
 	"github.com/superfly/flyctl/pkg/agent/internal/proto"
 	"github.com/superfly/flyctl/pkg/wg"
 
@@ -46,13 +45,13 @@ func Establish(ctx context.Context, apiClient *api.Client) (*Client, error) {
 			}
 
 			terminal.Debug(msg)
-			terminal.Debug("stopping agent")
-			if err := c.Kill(ctx); err != nil {
+			terminal.Debug("reloading agent")
+			if err := c.Reload(ctx); err != nil {
 				terminal.Warn(msg)
-				return nil, errors.Wrap(err, "kill failed")
+				return nil, errors.Wrap(err, "reload failed")
 			}
-			// this is gross, but we need to wait for the agent to exit
-			time.Sleep(1 * time.Second)
+
+			return c, nil
 		}
 	}
 
@@ -68,85 +67,96 @@ const (
 	cycle   = time.Second / 10
 )
 
+// newClient gets a (possibly pooled) gRPC connection to the agent over the
+// given network/address - normally the unix socket returned by
+// PathToSocket - and pings it to make sure something is actually listening.
 func newClient(ctx context.Context, network, addr string) (client *Client, err error) {
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := pool.get(dialCtx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
 	client = &Client{
 		network: network,
 		address: addr,
+		conn:    conn,
+		rpc:     proto.NewAgentServiceClient(conn),
 	}
 
 	if _, err = client.Ping(ctx); err != nil {
+		_ = pool.release(network, addr) // undo the ref pool.get just took
 		client = nil
 	}
 
 	return
 }
 
+// Client is a thin wrapper around the generated AgentService stub; it holds
+// no protocol knowledge of its own beyond translating between the RPC
+// messages and the public Go types flyctl commands already depend on.
 type Client struct {
 	network string
 	address string
-	dialer  net.Dialer
+
+	conn *grpc.ClientConn
+	rpc  proto.AgentServiceClient
 }
 
-func (c *Client) dial() (conn net.Conn, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// Close releases this Client's reference to its pooled connection, closing
+// it for real once every Client sharing it has done the same. Callers that
+// keep a Client around for a command's lifetime should defer it so flyctl
+// tears down its session cleanly on exit instead of relying on the daemon
+// to notice the socket went away.
+func (c *Client) Close() error {
+	return pool.release(c.network, c.address)
+}
 
-	return c.dialContext(ctx)
+func (c *Client) Kill(ctx context.Context) error {
+	_, err := c.rpc.Kill(ctx, &proto.KillRequest{})
+	return err
 }
 
-func (c *Client) dialContext(ctx context.Context) (conn net.Conn, err error) {
-	return c.dialer.DialContext(ctx, c.network, c.address)
+// Reload asks the running daemon to fork a replacement daemon that inherits
+// the listening socket and any active tunnels. It returns once the
+// replacement process has been started; it does not wait for the
+// replacement to serve the socket, and the daemon that answered keeps
+// running and accepting on the same socket.
+func (c *Client) Reload(ctx context.Context) error {
+	_, err := c.rpc.Reload(ctx, &proto.ReloadRequest{})
+	return err
 }
 
-func (c *Client) do(parent context.Context, fn func(net.Conn) error) (err error) {
-	var conn net.Conn
-	if conn, err = c.dialContext(parent); err != nil {
-		return err
+// Status reports each of the daemon's supervised subsystems - the unix
+// listener, per-org tunnels, the resolver, the health prober - along with
+// its uptime, last error and restart count. The daemon does not track
+// per-service connections, so Conns is always zero.
+func (c *Client) Status(ctx context.Context) (services []ServiceStatus, err error) {
+	var out *proto.StatusResponse
+	if out, err = c.rpc.Status(ctx, &proto.StatusRequest{}); err != nil {
+		return
 	}
 
-	ctx, cancel := context.WithCancel(parent)
-
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	var closeError error
-	defer func() {
-		if err == nil {
-			err = closeError
+	services = make([]ServiceStatus, len(out.Services))
+	for i, s := range out.Services {
+		st := ServiceStatus{
+			Name:     s.Name,
+			Uptime:   time.Duration(s.UptimeNs),
+			Restarts: int(s.Restarts),
+			Conns:    int(s.Conns),
 		}
-	}()
-
-	go func() {
-		defer wg.Done()
-
-		select {
-		case <-ctx.Done():
-			closeError = conn.Close()
+		if s.LastError != "" {
+			st.LastErr = errors.New(s.LastError)
 		}
-	}()
-
-	go func() {
-		defer wg.Done()
-
-		err = fn(conn)
-		cancel()
-	}()
 
-	wg.Wait()
-
-	if err != nil && ctx.Err() != nil {
-		err = ctx.Err()
+		services[i] = st
 	}
 
 	return
 }
 
-func (c *Client) Kill(ctx context.Context) error {
-	return c.do(ctx, func(conn net.Conn) error {
-		return proto.Write(conn, "kill")
-	})
-}
-
 type PingResponse struct {
 	PID        int
 	Version    semver.Version
@@ -154,33 +164,15 @@ type PingResponse struct {
 }
 
 func (c *Client) Ping(ctx context.Context) (res PingResponse, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "ping"); err != nil {
-			return
-		}
-
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		if err = hasPrefix(data, "pong "); err == nil {
-			err = json.Unmarshal(data[5:], &res)
-		}
-
+	var out *proto.PingResponse
+	if out, err = c.rpc.Ping(ctx, &proto.PingRequest{}); err != nil {
 		return
-	})
-
-	return
-}
-
-func hasPrefix(data []byte, prefix string) (err error) {
-	if !strings.HasPrefix(string(data), prefix) {
-		format := fmt.Sprintf("invalid prefix: %%.%dq", len(prefix))
-
-		err = fmt.Errorf(format, string(data))
 	}
 
+	res.PID = int(out.Pid)
+	res.Background = out.Background
+	res.Version, err = semver.Parse(out.Version)
+
 	return
 }
 
@@ -190,75 +182,43 @@ type EstablishResponse struct {
 }
 
 func (c *Client) Establish(ctx context.Context, slug string) (res *EstablishResponse, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "establish", slug); err != nil {
-			return
-		}
-
-		// this goes out to the API; don't time it out aggressively
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		if err = hasPrefix(data, "ok "); err != nil {
-			err = errors.New(string(data))
-
-			return
-		}
-
-		res = &EstablishResponse{}
-		if err = json.Unmarshal(data, res); err != nil {
-			res = nil
-		}
+	// this goes out to the API; don't time it out aggressively
+	var out *proto.EstablishResponse
+	if out, err = c.rpc.Establish(ctx, &proto.EstablishRequest{Slug: slug}); err != nil {
+		return
+	}
 
+	res = &EstablishResponse{}
+	if err = json.Unmarshal(out.WireGuardState, &res.WireGuardState); err != nil {
+		res = nil
 		return
-	})
+	}
+	if err = json.Unmarshal(out.TunnelConfig, &res.TunnelConfig); err != nil {
+		res = nil
+	}
 
 	return
 }
 
 func (c *Client) Probe(ctx context.Context, slug string) error {
-	return c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "probe", slug); err != nil {
-			return
-		}
-
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		if string(data) != "ok" {
-			err = errors.New(string(data))
-		}
-
-		return
-	})
+	_, err := c.rpc.Probe(ctx, &proto.ProbeRequest{Slug: slug})
+	return err
 }
 
 func (c *Client) Resolve(ctx context.Context, slug, host string) (addr string, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "resolve", slug, host); err != nil {
-			return
-		}
-
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		if err = hasPrefix(data, "ok "); err == nil {
-			addr = string(data[3:])
-		}
-
-		return
-	})
+	var out *proto.ResolveResponse
+	if out, err = c.rpc.Resolve(ctx, &proto.ResolveRequest{Slug: slug, Host: host}); err == nil {
+		addr = out.Addr
+	}
 
 	return
 }
 
 func (c *Client) WaitForTunnel(ctx context.Context, org *api.Organization) (err error) {
+	if events, serr := c.Subscribe(ctx); serr == nil {
+		return waitForEvent(ctx, events, org.Slug, "", EventTunnelEstablished, EventHandshakeCompleted)
+	}
+
 	for {
 		if err = c.Probe(ctx, org.Slug); !IsTunnelError(err) {
 			break // we only reset on tunnel errors
@@ -271,6 +231,10 @@ func (c *Client) WaitForTunnel(ctx context.Context, org *api.Organization) (err
 }
 
 func (c *Client) WaitForHost(ctx context.Context, org *api.Organization, host string) (err error) {
+	if events, serr := c.Subscribe(ctx); serr == nil {
+		return waitForEvent(ctx, events, org.Slug, host, EventTunnelEstablished, EventHandshakeCompleted)
+	}
+
 	for {
 		if _, err = c.Resolve(ctx, org.Slug, host); !IsTunnelError(err) && !IsHostNotFoundError(err) {
 			break
@@ -283,23 +247,11 @@ func (c *Client) WaitForHost(ctx context.Context, org *api.Organization, host st
 }
 
 func (c *Client) Instances(ctx context.Context, org *api.Organization, app string) (instances Instances, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "instances", org.Slug, app); err != nil {
-			return
-		}
-
-		// this goes out to the network; don't time it out aggressively
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		if err = hasPrefix(data, "ok "); err == nil {
-			err = json.Unmarshal(data[3:], &instances)
-		}
-
-		return
-	})
+	// this goes out to the network; don't time it out aggressively
+	var out *proto.InstancesResponse
+	if out, err = c.rpc.Instances(ctx, &proto.InstancesRequest{Slug: org.Slug, App: app}); err == nil {
+		err = json.Unmarshal(out.Instances, &instances)
+	}
 
 	return
 }
@@ -343,32 +295,36 @@ func (d *dialer) Config() *wg.Config {
 	return d.config
 }
 
+// DialContext opens the Connect stream, sends the dial frame describing the
+// destination, and waits for the daemon's ack before handing back a net.Conn
+// that shuttles bytes over the stream.
 func (d *dialer) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
-	if conn, err = d.client.dialContext(ctx); err != nil {
+	var stream proto.AgentService_ConnectClient
+	if stream, err = d.client.rpc.Connect(ctx); err != nil {
 		return
 	}
-	defer func() {
-		if err != nil {
-			_ = conn.Close()
-			conn = nil
-		}
-	}()
 
-	timeout := strconv.FormatInt(int64(d.timeout), 10)
-	if err = proto.Write(conn, "connect", d.slug, addr, timeout); err != nil {
+	if err = stream.Send(&proto.ConnectFrame{
+		Slug:      d.slug,
+		Network:   network,
+		Addr:      addr,
+		TimeoutNs: int64(d.timeout),
+	}); err != nil {
 		return
 	}
 
-	var data []byte
-	if data, err = proto.Read(conn); err != nil {
+	var ack *proto.ConnectFrame
+	if ack, err = stream.Recv(); err != nil {
 		return
 	}
 
-	if string(data) != "ok" {
-		err = mapError(errors.New(string(data)), d.slug, addr)
+	if ack.Error != "" {
+		err = mapError(errors.New(ack.Error), d.slug, addr)
 
 		return
 	}
 
+	conn = newStreamConn(stream)
+
 	return
 }
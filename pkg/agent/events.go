@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/superfly/flyctl/pkg/agent/internal/proto"
+)
+
+// EventKind categorizes an Event delivered over Client.Subscribe.
+type EventKind int
+
+const (
+	EventUnspecified EventKind = iota
+	EventTunnelEstablished
+	EventTunnelTornDown
+	EventHandshakeCompleted
+	EventProbeSucceeded
+	EventProbeFailed
+	EventResolveFailed
+	EventPeersPruned
+	EventReloading
+	EventShuttingDown
+)
+
+// Event is a daemon-lifecycle or tunnel-health notification: a tunnel
+// coming up or down for an org, a completed handshake, a probe or resolve
+// outcome, a PruneInvalidPeers result, or the daemon reloading/shutting
+// down. Subscribing to these lets WaitForTunnel and WaitForHost react
+// immediately instead of polling Probe/Resolve.
+type Event struct {
+	Kind    EventKind
+	Slug    string
+	Host    string
+	Message string
+	At      time.Time
+}
+
+func eventFromProto(e *proto.Event) Event {
+	return Event{
+		Kind:    EventKind(e.Kind),
+		Slug:    e.Slug,
+		Host:    e.Host,
+		Message: e.Message,
+		At:      time.Unix(0, e.UnixNano),
+	}
+}
+
+// Subscribe streams daemon events until ctx is done or the daemon closes
+// the stream, at which point the returned channel is closed. It returns an
+// error immediately if the daemon predates the Subscribe RPC, so callers
+// can fall back to polling.
+func (c *Client) Subscribe(ctx context.Context) (<-chan Event, error) {
+	stream, err := c.rpc.Subscribe(ctx, &proto.SubscribeRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscribe is server-streaming: the generated client sends the request
+	// and returns before the server has replied at all, so a daemon whose
+	// Subscribe is still the embedded UnimplementedAgentServiceServer stub
+	// doesn't fail here - the Unimplemented status only surfaces once the
+	// handler actually runs. Header blocks until that happens (or the
+	// server sends its first event, whichever comes first), so callers
+	// find out now, while they can still fall back to polling, rather than
+	// committing to a stream that's already dead.
+	if _, err := stream.Header(); err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		for {
+			e, err := stream.Recv()
+			if err != nil {
+				return
+			}
+
+			select {
+			case events <- eventFromProto(e):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// waitForEvent blocks until events reports one of kinds for slug (and, when
+// set, host), the stream closes, or ctx is done.
+func waitForEvent(ctx context.Context, events <-chan Event, slug, host string, kinds ...EventKind) error {
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return errors.New("agent: event stream closed before a matching event arrived")
+			}
+
+			if e.Slug != slug || (host != "" && e.Host != host) {
+				continue
+			}
+
+			for _, k := range kinds {
+				if e.Kind == k {
+					return nil
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/pkg/agent/internal/proto"
+)
+
+// subscribingAgentServer answers Subscribe with a single canned event, so
+// tests can check that WaitForTunnel/WaitForHost use the event stream
+// instead of polling Probe/Resolve when the daemon offers one.
+type subscribingAgentServer struct {
+	fakeAgentServer
+
+	event *proto.Event
+}
+
+func (s *subscribingAgentServer) Subscribe(_ *proto.SubscribeRequest, stream proto.AgentService_SubscribeServer) error {
+	if err := stream.Send(s.event); err != nil {
+		return err
+	}
+
+	<-stream.Context().Done()
+	return stream.Context().Err()
+}
+
+// probingAgentServer doesn't override Subscribe, so it falls through to
+// UnimplementedAgentServiceServer and stands in for a daemon that predates
+// the Subscribe RPC.
+type probingAgentServer struct {
+	fakeAgentServer
+
+	probed chan string
+}
+
+func (s *probingAgentServer) Probe(_ context.Context, req *proto.ProbeRequest) (*proto.ProbeResponse, error) {
+	select {
+	case s.probed <- req.Slug:
+	default:
+	}
+
+	return &proto.ProbeResponse{}, nil
+}
+
+func TestWaitForTunnelFallsBackToPollingWithoutSubscribe(t *testing.T) {
+	srv := &probingAgentServer{probed: make(chan string, 1)}
+
+	addr, _, stop := startFakeAgent(t, srv)
+	defer stop()
+
+	resetPool()
+
+	c, err := newClient(context.Background(), "unix", addr)
+	if err != nil {
+		t.Fatalf("newClient: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := c.WaitForTunnel(ctx, &api.Organization{Slug: "my-org"}); err != nil {
+		t.Fatalf("WaitForTunnel: %s", err)
+	}
+
+	select {
+	case slug := <-srv.probed:
+		if slug != "my-org" {
+			t.Fatalf("Probe called with slug %q, want %q", slug, "my-org")
+		}
+	default:
+		t.Fatal("expected WaitForTunnel to fall back to polling Probe when Subscribe is unimplemented")
+	}
+}
+
+// TestSubscribeReplaysLastEventForSlug exercises the real Server/hub, not a
+// fake one: it publishes a tunnel event before anyone has subscribed - the
+// normal Establish-then-WaitForTunnel order - and checks WaitForTunnel
+// still returns promptly instead of waiting on a stream that already
+// missed it.
+func TestSubscribeReplaysLastEventForSlug(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "agent.sock")
+
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	s := newServer(l)
+	s.events.publish(&proto.Event{
+		Kind: proto.EventKind_TUNNEL_ESTABLISHED,
+		Slug: "my-org",
+	})
+
+	gs := grpc.NewServer(grpc.ForceServerCodec(proto.Codec))
+	proto.RegisterAgentServiceServer(gs, s)
+	go gs.Serve(l)
+	defer gs.Stop()
+
+	resetPool()
+
+	c, err := newClient(context.Background(), "unix", addr)
+	if err != nil {
+		t.Fatalf("newClient: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := c.WaitForTunnel(ctx, &api.Organization{Slug: "my-org"}); err != nil {
+		t.Fatalf("WaitForTunnel: %s", err)
+	}
+}
+
+func TestWaitForTunnelPrefersEventStream(t *testing.T) {
+	srv := &subscribingAgentServer{event: &proto.Event{
+		Kind: proto.EventKind_TUNNEL_ESTABLISHED,
+		Slug: "my-org",
+	}}
+
+	addr, _, stop := startFakeAgent(t, srv)
+	defer stop()
+
+	resetPool()
+
+	c, err := newClient(context.Background(), "unix", addr)
+	if err != nil {
+		t.Fatalf("newClient: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := c.WaitForTunnel(ctx, &api.Organization{Slug: "my-org"}); err != nil {
+		t.Fatalf("WaitForTunnel: %s", err)
+	}
+}
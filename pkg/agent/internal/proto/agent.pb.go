@@ -0,0 +1,102 @@
+// Hand-written Go types mirroring agent.proto; see codec.go for how they
+// are encoded on the wire.
+// source: agent.proto
+
+package proto
+
+type PingRequest struct{}
+
+type PingResponse struct {
+	Pid        int32  `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
+	Version    string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Background bool   `protobuf:"varint,3,opt,name=background,proto3" json:"background,omitempty"`
+}
+
+type EstablishRequest struct {
+	Slug string `protobuf:"bytes,1,opt,name=slug,proto3" json:"slug,omitempty"`
+}
+
+type EstablishResponse struct {
+	WireGuardState []byte `protobuf:"bytes,1,opt,name=wire_guard_state,json=wireGuardState,proto3" json:"wire_guard_state,omitempty"`
+	TunnelConfig   []byte `protobuf:"bytes,2,opt,name=tunnel_config,json=tunnelConfig,proto3" json:"tunnel_config,omitempty"`
+}
+
+type ProbeRequest struct {
+	Slug string `protobuf:"bytes,1,opt,name=slug,proto3" json:"slug,omitempty"`
+}
+
+type ProbeResponse struct{}
+
+type ResolveRequest struct {
+	Slug string `protobuf:"bytes,1,opt,name=slug,proto3" json:"slug,omitempty"`
+	Host string `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`
+}
+
+type ResolveResponse struct {
+	Addr string `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
+}
+
+type InstancesRequest struct {
+	Slug string `protobuf:"bytes,1,opt,name=slug,proto3" json:"slug,omitempty"`
+	App  string `protobuf:"bytes,2,opt,name=app,proto3" json:"app,omitempty"`
+}
+
+type InstancesResponse struct {
+	Instances []byte `protobuf:"bytes,1,opt,name=instances,proto3" json:"instances,omitempty"`
+}
+
+type ConnectFrame struct {
+	Slug      string `protobuf:"bytes,1,opt,name=slug,proto3" json:"slug,omitempty"`
+	Network   string `protobuf:"bytes,2,opt,name=network,proto3" json:"network,omitempty"`
+	Addr      string `protobuf:"bytes,3,opt,name=addr,proto3" json:"addr,omitempty"`
+	TimeoutNs int64  `protobuf:"varint,4,opt,name=timeout_ns,json=timeoutNs,proto3" json:"timeout_ns,omitempty"`
+	Data      []byte `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	Error     string `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+type KillRequest struct{}
+
+type KillResponse struct{}
+
+type ReloadRequest struct{}
+
+type ReloadResponse struct{}
+
+type ServiceStatus struct {
+	Name      string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	UptimeNs  int64  `protobuf:"varint,2,opt,name=uptime_ns,json=uptimeNs,proto3" json:"uptime_ns,omitempty"`
+	LastError string `protobuf:"bytes,3,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	Restarts  int32  `protobuf:"varint,4,opt,name=restarts,proto3" json:"restarts,omitempty"`
+	Conns     int32  `protobuf:"varint,5,opt,name=conns,proto3" json:"conns,omitempty"`
+}
+
+type StatusRequest struct{}
+
+type StatusResponse struct {
+	Services []*ServiceStatus `protobuf:"bytes,1,rep,name=services,proto3" json:"services,omitempty"`
+}
+
+type EventKind int32
+
+const (
+	EventKind_EVENT_KIND_UNSPECIFIED EventKind = 0
+	EventKind_TUNNEL_ESTABLISHED     EventKind = 1
+	EventKind_TUNNEL_TORN_DOWN       EventKind = 2
+	EventKind_HANDSHAKE_COMPLETED    EventKind = 3
+	EventKind_PROBE_SUCCEEDED        EventKind = 4
+	EventKind_PROBE_FAILED           EventKind = 5
+	EventKind_RESOLVE_FAILED         EventKind = 6
+	EventKind_PEERS_PRUNED           EventKind = 7
+	EventKind_RELOADING              EventKind = 8
+	EventKind_SHUTTING_DOWN          EventKind = 9
+)
+
+type Event struct {
+	Kind     EventKind `protobuf:"varint,1,opt,name=kind,proto3,enum=agent.EventKind" json:"kind,omitempty"`
+	Slug     string    `protobuf:"bytes,2,opt,name=slug,proto3" json:"slug,omitempty"`
+	Host     string    `protobuf:"bytes,3,opt,name=host,proto3" json:"host,omitempty"`
+	Message  string    `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	UnixNano int64     `protobuf:"varint,5,opt,name=unix_nano,json=unixNano,proto3" json:"unix_nano,omitempty"`
+}
+
+type SubscribeRequest struct{}
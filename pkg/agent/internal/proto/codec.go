@@ -0,0 +1,33 @@
+package proto
+
+import "encoding/json"
+
+// Codec marshals the message types in this package over the wire. They are
+// plain structs with protobuf struct tags, hand-written rather than
+// generated by protoc-gen-go, so they don't implement proto.Message and
+// grpc-go's default "proto" codec can't encode them. Their json tags (also
+// hand-written to match what protoc-gen-go would emit) make encoding/json a
+// drop-in replacement; the messages here are small and infrequent enough
+// that the extra wire overhead doesn't matter.
+//
+// Codec is deliberately not registered globally via encoding.RegisterCodec:
+// doing so under the name "proto" would override grpc-go's default codec
+// for the whole process, silently breaking any other gRPC client or server
+// in the flyctl binary that actually speaks protobuf. Callers instead force
+// it with grpc.ForceCodec/grpc.ForceServerCodec, scoped to this service's
+// own ClientConn/Server.
+var Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "agent-json"
+}
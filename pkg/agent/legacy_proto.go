@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// legacyWrite and legacyRead implement the length-prefixed line protocol
+// flyctl agents spoke before the gRPC rewrite. The daemon keeps them around
+// solely to answer ping/kill/reload for an older flyctl binary talking to a
+// freshly upgraded agent, so a rolling upgrade doesn't strand it.
+func legacyWrite(w io.Writer, parts ...string) error {
+	line := strings.Join(parts, " ")
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(line)))
+
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, line)
+	return err
+}
+
+func legacyRead(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+
+	var length [4]byte
+	if _, err := io.ReadFull(br, length[:]); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/superfly/flyctl/pkg/agent/internal/proto"
+)
+
+// clientPool hands out one *grpc.ClientConn per (network, address) pair, so
+// that repeated DefaultClient calls - one per Probe, Resolve or Dialer call
+// in the old line-protocol days - reuse an existing connection instead of
+// dialing the unix socket again. Every RPC and every tunnel dial (Connect
+// is a bidi stream) gets its own HTTP/2 stream multiplexed over that one
+// connection, which is the same win a yamux session over a raw conn would
+// buy us - gRPC already is that session, so there's no second mux layer to
+// add on top of it.
+type clientPool struct {
+	mu    sync.Mutex
+	conns map[string]*entry
+}
+
+type entry struct {
+	conn *grpc.ClientConn
+	refs int
+}
+
+var pool = &clientPool{conns: map[string]*entry{}}
+
+func (p *clientPool) get(ctx context.Context, network, addr string) (conn *grpc.ClientConn, err error) {
+	key := network + ":" + addr
+
+	p.mu.Lock()
+	if e := p.conns[key]; e != nil {
+		if e.conn.GetState() != connectivity.Shutdown {
+			e.refs++
+			p.mu.Unlock()
+			return e.conn, nil
+		}
+
+		delete(p.conns, key)
+	}
+	p.mu.Unlock()
+
+	if conn, err = dial(ctx, network, addr); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.conns[key] = &entry{conn: conn, refs: 1}
+	p.mu.Unlock()
+
+	return conn, nil
+}
+
+// release drops one reference to the pooled connection for (network, addr),
+// closing it once the last Client using it has gone away.
+func (p *clientPool) release(network, addr string) error {
+	key := network + ":" + addr
+
+	p.mu.Lock()
+	e := p.conns[key]
+	if e == nil {
+		p.mu.Unlock()
+		return nil
+	}
+
+	e.refs--
+	if e.refs > 0 {
+		p.mu.Unlock()
+		return nil
+	}
+
+	delete(p.conns, key)
+	p.mu.Unlock()
+
+	return e.conn.Close()
+}
+
+func dial(ctx context.Context, network, addr string) (*grpc.ClientConn, error) {
+	return grpc.DialContext(ctx, addr,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+		grpc.ForceCodec(proto.Codec),
+	)
+}
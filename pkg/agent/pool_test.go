@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/superfly/flyctl/pkg/agent/internal/proto"
+)
+
+// countingListener counts completed Accepts, so tests can tell a pooled
+// connection from a freshly dialed one.
+type countingListener struct {
+	net.Listener
+	accepts int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepts, 1)
+	}
+
+	return conn, err
+}
+
+type fakeAgentServer struct {
+	proto.UnimplementedAgentServiceServer
+
+	pingDelay time.Duration
+}
+
+func (s *fakeAgentServer) Ping(ctx context.Context, _ *proto.PingRequest) (*proto.PingResponse, error) {
+	if s.pingDelay > 0 {
+		select {
+		case <-time.After(s.pingDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return &proto.PingResponse{Version: "0.0.0"}, nil
+}
+
+func (s *fakeAgentServer) Establish(ctx context.Context, _ *proto.EstablishRequest) (*proto.EstablishResponse, error) {
+	<-ctx.Done() // never replies on its own; only cancellation ends this call
+
+	return nil, ctx.Err()
+}
+
+func startFakeAgent(t *testing.T, srv proto.AgentServiceServer) (addr string, cl *countingListener, stop func()) {
+	t.Helper()
+
+	addr = filepath.Join(t.TempDir(), "agent.sock")
+
+	raw, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	cl = &countingListener{Listener: raw}
+
+	gs := grpc.NewServer(grpc.ForceServerCodec(proto.Codec))
+	proto.RegisterAgentServiceServer(gs, srv)
+
+	go gs.Serve(cl)
+
+	return addr, cl, func() {
+		gs.Stop()
+		os.Remove(addr)
+	}
+}
+
+func resetPool() {
+	pool = &clientPool{conns: map[string]*entry{}}
+}
+
+func TestPoolReusesConnection(t *testing.T) {
+	addr, cl, stop := startFakeAgent(t, &fakeAgentServer{})
+	defer stop()
+
+	resetPool()
+
+	for i := 0; i < 3; i++ {
+		if _, err := newClient(context.Background(), "unix", addr); err != nil {
+			t.Fatalf("newClient: %s", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&cl.accepts); got != 1 {
+		t.Fatalf("expected exactly one dial to reach the listener, got %d", got)
+	}
+}
+
+func TestPingTimeoutDoesNotLeakGoroutines(t *testing.T) {
+	addr, _, stop := startFakeAgent(t, &fakeAgentServer{pingDelay: time.Second})
+	defer stop()
+
+	resetPool()
+
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := newClient(ctx, "unix", addr); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+
+	time.Sleep(50 * time.Millisecond) // give any leaked goroutines a chance to show up
+
+	if after := runtime.NumGoroutine(); after > before+2 {
+		t.Fatalf("goroutine count grew from %d to %d after a timed-out Ping", before, after)
+	}
+}
+
+func TestFailedPingReleasesPoolRef(t *testing.T) {
+	addr, _, stop := startFakeAgent(t, &fakeAgentServer{pingDelay: time.Second})
+	defer stop()
+
+	resetPool()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := newClient(ctx, "unix", addr); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+
+	pool.mu.Lock()
+	_, leaked := pool.conns["unix:"+addr]
+	pool.mu.Unlock()
+
+	if leaked {
+		t.Fatal("expected newClient to release the pool ref it took once Ping failed")
+	}
+}
+
+func TestClientCloseKeepsSharedConnectionOpen(t *testing.T) {
+	addr, cl, stop := startFakeAgent(t, &fakeAgentServer{})
+	defer stop()
+
+	resetPool()
+
+	a, err := newClient(context.Background(), "unix", addr)
+	if err != nil {
+		t.Fatalf("newClient: %s", err)
+	}
+
+	b, err := newClient(context.Background(), "unix", addr)
+	if err != nil {
+		t.Fatalf("newClient: %s", err)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	if _, err := b.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping on b after a.Close: %s", err)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	if got := atomic.LoadInt32(&cl.accepts); got != 1 {
+		t.Fatalf("expected the pooled connection to have been dialed once, got %d", got)
+	}
+}
+
+func TestEstablishCancellationReturnsPromptly(t *testing.T) {
+	addr, _, stop := startFakeAgent(t, &fakeAgentServer{})
+	defer stop()
+
+	resetPool()
+
+	c, err := newClient(context.Background(), "unix", addr)
+	if err != nil {
+		t.Fatalf("newClient: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := c.Establish(ctx, "test-org")
+		done <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error once the context was canceled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Establish did not return promptly after cancellation")
+	}
+}
@@ -0,0 +1,660 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/superfly/flyctl/internal/buildinfo"
+	"github.com/superfly/flyctl/pkg/agent/internal/proto"
+	"github.com/superfly/flyctl/terminal"
+)
+
+// reloadEnvKey carries the JSON-encoded reloadManifest to a forked child so
+// it can rebind the inherited FDs instead of creating its own socket.
+const reloadEnvKey = "FLY_AGENT_RELOAD_MANIFEST"
+
+// reloadManifest describes the file descriptors handed down to a child
+// process across a live-reload, in the order they appear in cmd.ExtraFiles
+// (which always starts at fd 3).
+type reloadManifest struct {
+	ListenerFD int      `json:"listener_fd"`
+	TunnelFDs  []int    `json:"tunnel_fds"`
+	TunnelKeys []string `json:"tunnel_keys"` // org slug for each entry in TunnelFDs
+}
+
+// drainTimeout bounds how long shutdown waits for in-flight requests and
+// open tunnel conns before giving up.
+const drainTimeout = 30 * time.Second
+
+// http2Preface is the first bytes of any gRPC (HTTP/2) client connection;
+// anything else on the socket is assumed to be an older flyctl binary
+// speaking the line protocol this daemon no longer uses natively.
+const http2Preface = "PRI * HTTP/2.0"
+
+// tunnel is the daemon-side record of an established WireGuard tunnel for an
+// org, kept around so it can be handed off to a child process on reload.
+type tunnel struct {
+	slug string
+	conn *net.UnixConn
+}
+
+func (t *tunnel) file() (*os.File, error) {
+	return t.conn.File()
+}
+
+// Server is the daemon side of the agent: it owns the unix listener and the
+// set of established tunnels, and answers the requests issued by Client.
+type Server struct {
+	proto.UnimplementedAgentServiceServer
+
+	listener   net.Listener
+	grpc       *grpc.Server
+	demux      *demuxListener
+	supervisor *Supervisor
+	events     *hub
+
+	mu      sync.Mutex
+	tunnels map[string]*tunnel // keyed by org slug
+
+	draining chan struct{}
+	drainWG  sync.WaitGroup
+}
+
+// NewServer binds a fresh unix socket at PathToSocket, unless this process
+// was forked for a live-reload, in which case it rebinds the listener and
+// tunnels inherited from its parent.
+func NewServer(ctx context.Context) (*Server, error) {
+	if raw := os.Getenv(reloadEnvKey); raw != "" {
+		return resumeServer(raw)
+	}
+
+	l, err := net.Listen("unix", PathToSocket())
+	if err != nil {
+		return nil, errors.Wrap(err, "listen")
+	}
+
+	return newServer(l), nil
+}
+
+func newServer(l net.Listener) *Server {
+	return &Server{
+		listener:   l,
+		tunnels:    map[string]*tunnel{},
+		draining:   make(chan struct{}),
+		demux:      newDemuxListener(),
+		supervisor: NewSupervisor(),
+		events:     newHub(),
+	}
+}
+
+// listenerService wraps Server.accept as a supervised Service so the unix
+// listener shows up in Status and is torn down through the same dependency
+// graph as everything else.
+type listenerService struct {
+	s    *Server
+	done chan error
+}
+
+func (l *listenerService) Name() string { return "listener" }
+
+func (l *listenerService) Start(ctx context.Context) error {
+	l.done = make(chan error, 1)
+
+	go func() {
+		l.s.accept(ctx)
+		l.done <- nil
+	}()
+
+	return nil
+}
+
+func (l *listenerService) Wait() error {
+	return <-l.done
+}
+
+// tunnelService supervises one entry in Server.tunnels so it shows up in
+// Status alongside the listener. It watches the tunnel's socket rather than
+// the WireGuard session behind it: this tree has no wg/wireguard package to
+// redial with, so Establish has nothing to hand a tunnelService on a
+// transient handshake error yet (Establish itself is still the embedded
+// UnimplementedAgentServiceServer stub below). Once real tunnel
+// establishment lands, a failed handshake should make Wait return a
+// non-nil error instead of nil, so the supervisor's backoff retries the
+// redial instead of treating the loss as an ordinary teardown.
+type tunnelService struct {
+	s *Server
+	t *tunnel
+
+	done chan error
+}
+
+func (ts *tunnelService) Name() string { return "tunnel:" + ts.t.slug }
+
+func (ts *tunnelService) Start(ctx context.Context) error {
+	ts.done = make(chan error, 1)
+
+	// Nothing closes ts.t.conn on its own, so without this the blocking
+	// Read below would never see ctx canceled and Supervisor.Stop - and
+	// shutdown along with it - would hang forever waiting on Wait.
+	go func() {
+		<-ctx.Done()
+		_ = ts.t.conn.Close()
+	}()
+
+	go func() {
+		// Nothing else in this tree reads or writes this conn - it's only
+		// ever kept around to hand off across a reload - so blocking on a
+		// read is a safe, if blunt, way to notice the fd went away.
+		_, err := ts.t.conn.Read(make([]byte, 1))
+
+		ts.s.mu.Lock()
+		delete(ts.s.tunnels, ts.t.slug)
+		ts.s.mu.Unlock()
+
+		ts.s.events.publish(&proto.Event{
+			Kind:     proto.EventKind_TUNNEL_TORN_DOWN,
+			Slug:     ts.t.slug,
+			UnixNano: time.Now().UnixNano(),
+		})
+
+		if err == io.EOF {
+			err = nil // closed deliberately; don't have the supervisor restart it
+		}
+
+		ts.done <- err
+	}()
+
+	return nil
+}
+
+func (ts *tunnelService) Wait() error {
+	return <-ts.done
+}
+
+// hub fans daemon events out to every active Subscribe stream. A slow
+// subscriber drops events rather than stalling the daemon. It also keeps
+// the most recent event per (slug, host) and replays those to a new
+// subscriber immediately: Establish/the tunnel coming up and WaitForTunnel
+// subscribing afterward is the normal call order, so without a replay the
+// event a fresh Subscribe is waiting for has usually already fired and
+// would otherwise be missed until the stream's next one - or the caller's
+// deadline.
+type hub struct {
+	mu   sync.Mutex
+	subs map[chan *proto.Event]struct{}
+	last map[string]*proto.Event
+}
+
+func newHub() *hub {
+	return &hub{
+		subs: map[chan *proto.Event]struct{}{},
+		last: map[string]*proto.Event{},
+	}
+}
+
+// lastEventKey identifies the (slug, host) an event is scoped to, so e.g. a
+// TUNNEL_ESTABLISHED event (host always empty) and a HANDSHAKE_COMPLETED
+// for one particular host don't overwrite each other's replay slot.
+func lastEventKey(slug, host string) string {
+	return slug + "\x00" + host
+}
+
+func (h *hub) publish(e *proto.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e.Slug != "" {
+		h.last[lastEventKey(e.Slug, e.Host)] = e
+	}
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (h *hub) subscribe() (ch chan *proto.Event, cancel func()) {
+	ch = make(chan *proto.Event, 16)
+
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	for _, e := range h.last {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+func resumeServer(raw string) (*Server, error) {
+	var m reloadManifest
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return nil, errors.Wrap(err, "decode reload manifest")
+	}
+
+	l, err := net.FileListener(os.NewFile(uintptr(m.ListenerFD), "agent.sock"))
+	if err != nil {
+		return nil, errors.Wrap(err, "rebind inherited listener")
+	}
+
+	s := newServer(l)
+
+	for i, fd := range m.TunnelFDs {
+		conn, err := net.FileConn(os.NewFile(uintptr(fd), "tunnel"))
+		if err != nil {
+			terminal.Warnf("failed to inherit tunnel %s: %s", m.TunnelKeys[i], err)
+			continue
+		}
+
+		uc, ok := conn.(*net.UnixConn)
+		if !ok {
+			terminal.Warnf("inherited tunnel %s has unexpected type %T", m.TunnelKeys[i], conn)
+			continue
+		}
+		s.tunnels[m.TunnelKeys[i]] = &tunnel{slug: m.TunnelKeys[i], conn: uc}
+	}
+
+	return s, nil
+}
+
+// Run serves the daemon until ctx is canceled or a terminal signal arrives.
+// SIGUSR2 and SIGHUP both fork a replacement daemon that inherits the
+// listener, then drain this process so the two don't sit there racing each
+// other to accept connections off the same fd. SIGTERM and SIGINT drain and
+// exit without forking.
+func (s *Server) Run(ctx context.Context) error {
+	s.grpc = grpc.NewServer(grpc.ForceServerCodec(proto.Codec))
+	proto.RegisterAgentServiceServer(s.grpc, s)
+
+	go func() {
+		_ = s.grpc.Serve(s.demux)
+	}()
+
+	s.supervisor.Add(&listenerService{s: s})
+
+	s.mu.Lock()
+	for _, t := range s.tunnels {
+		s.supervisor.Add(&tunnelService{s: s, t: t})
+	}
+	s.mu.Unlock()
+
+	// The resolver and health-prober the original request also asked for
+	// aren't modeled as Services here: Resolve and Probe are still
+	// UnimplementedAgentServiceServer stubs (see below) because this tree
+	// has no wg/wireguard package to back them with, so there's no standing
+	// background process for either one to supervise yet. Give each its own
+	// Service, the same way tunnels get one above, once they have real
+	// implementations to run.
+
+	if err := s.supervisor.Start(ctx); err != nil {
+		return errors.Wrap(err, "start services")
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR2, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return s.shutdown()
+		case got := <-sig:
+			switch got {
+			case syscall.SIGUSR2, syscall.SIGHUP:
+				if err := s.reexec(); err != nil {
+					terminal.Warnf("live-reload failed: %s", err)
+					continue
+				}
+				return s.shutdown()
+			case syscall.SIGTERM, syscall.SIGINT:
+				return s.shutdown()
+			}
+		}
+	}
+}
+
+// legacyProbeLen is how many bytes route peeks to tell a gRPC client from a
+// legacy one. It has to be shorter than the smallest legacy frame - a
+// 4-byte length prefix plus a short command, 8 bytes for "ping" or "kill" -
+// or Peek blocks forever on bytes a legacy client, already waiting on our
+// reply, will never send.
+const legacyProbeLen = 4
+
+// accept reads the first bytes off every new connection to tell a gRPC
+// client from an old-protocol one, then routes it accordingly.
+func (s *Server) accept(ctx context.Context) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.draining:
+				return // listener closed for drain; expected
+			default:
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			terminal.Warnf("accept: %s", err)
+			continue
+		}
+
+		s.drainWG.Add(1)
+		go func() {
+			defer s.drainWG.Done()
+			s.route(conn)
+		}()
+	}
+}
+
+func (s *Server) route(conn net.Conn) {
+	br := bufio.NewReader(conn)
+
+	probe, err := br.Peek(legacyProbeLen)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	pc := &peekedConn{Conn: conn, r: br}
+
+	// A real HTTP/2 client preface arrives as one write, so once its first
+	// few bytes match we can safely peek the rest without risking the same
+	// deadlock a full-length peek up front would cause against a short
+	// legacy frame.
+	if string(probe) == http2Preface[:legacyProbeLen] {
+		if preface, err := br.Peek(len(http2Preface)); err == nil && string(preface) == http2Preface {
+			select {
+			case s.demux.conns <- pc:
+			case <-s.draining:
+				conn.Close()
+			}
+			return
+		}
+	}
+
+	s.serveLegacy(pc)
+}
+
+// serveLegacy answers ping/kill/reload for flyctl binaries predating the
+// gRPC rewrite, so they can still detect and reload a mismatched agent.
+func (s *Server) serveLegacy(conn net.Conn) {
+	defer conn.Close()
+
+	data, err := legacyRead(conn)
+	if err != nil {
+		return
+	}
+
+	args := strings.Split(string(data), " ")
+
+	switch args[0] {
+	case "ping":
+		res, _ := s.Ping(context.Background(), &proto.PingRequest{})
+		payload, _ := json.Marshal(PingResponse{PID: int(res.Pid), Background: res.Background})
+		_ = legacyWrite(conn, "pong", string(payload))
+	case "kill":
+		_ = legacyWrite(conn, "ok")
+		_, _ = s.Kill(context.Background(), &proto.KillRequest{})
+	case "reload":
+		if _, err := s.Reload(context.Background(), &proto.ReloadRequest{}); err != nil {
+			_ = legacyWrite(conn, err.Error())
+			return
+		}
+		_ = legacyWrite(conn, "ok")
+	default:
+		_ = legacyWrite(conn, fmt.Sprintf("unsupported by old-protocol fallback: %q", args[0]))
+	}
+}
+
+// Ping implements proto.AgentServiceServer.
+func (s *Server) Ping(ctx context.Context, _ *proto.PingRequest) (*proto.PingResponse, error) {
+	return &proto.PingResponse{
+		Pid:        int32(os.Getpid()),
+		Version:    buildinfo.Version().String(),
+		Background: true,
+	}, nil
+}
+
+// Kill implements proto.AgentServiceServer. The process exits shortly after
+// replying so the response makes it back to the caller first.
+func (s *Server) Kill(ctx context.Context, _ *proto.KillRequest) (*proto.KillResponse, error) {
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.Exit(0)
+	}()
+
+	return &proto.KillResponse{}, nil
+}
+
+// Reload implements proto.AgentServiceServer.
+func (s *Server) Reload(ctx context.Context, _ *proto.ReloadRequest) (*proto.ReloadResponse, error) {
+	if err := s.reexec(); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &proto.ReloadResponse{}, nil
+}
+
+// Status implements proto.AgentServiceServer, reporting every supervised
+// service's uptime, last error and restart count so `flyctl agent status`
+// can show more than a single PingResponse.
+func (s *Server) Status(ctx context.Context, _ *proto.StatusRequest) (*proto.StatusResponse, error) {
+	roster := s.supervisor.Status()
+
+	res := &proto.StatusResponse{Services: make([]*proto.ServiceStatus, len(roster))}
+	for i, svc := range roster {
+		ps := &proto.ServiceStatus{
+			Name:     svc.Name,
+			UptimeNs: int64(svc.Uptime),
+			Restarts: int32(svc.Restarts),
+			Conns:    int32(svc.Conns),
+		}
+		if svc.LastErr != nil {
+			ps.LastError = svc.LastErr.Error()
+		}
+
+		res.Services[i] = ps
+	}
+
+	return res, nil
+}
+
+// Subscribe implements proto.AgentServiceServer, streaming daemon events to
+// the caller until the stream's context is done. WaitForTunnel and
+// WaitForHost use this instead of polling Probe/Resolve when the daemon
+// supports it.
+func (s *Server) Subscribe(_ *proto.SubscribeRequest, stream proto.AgentService_SubscribeServer) error {
+	ch, cancel := s.events.subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case e := <-ch:
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// reexec forks a child that inherits the listener and every live tunnel
+// socket, encoded as a reloadManifest in its environment.
+func (s *Server) reexec() error {
+	s.events.publish(&proto.Event{
+		Kind:     proto.EventKind_RELOADING,
+		Message:  "forking replacement daemon",
+		UnixNano: time.Now().UnixNano(),
+	})
+
+	lf, err := listenerFile(s.listener)
+	if err != nil {
+		return errors.Wrap(err, "dup listener fd")
+	}
+
+	extra := []*os.File{lf}
+	manifest := reloadManifest{ListenerFD: 3} // fd 0-2 are stdio
+
+	s.mu.Lock()
+	for slug, t := range s.tunnels {
+		tf, err := t.file()
+		if err != nil {
+			terminal.Warnf("skipping tunnel %s in reload: %s", slug, err)
+			continue
+		}
+
+		extra = append(extra, tf)
+		manifest.TunnelFDs = append(manifest.TunnelFDs, 2+len(extra))
+		manifest.TunnelKeys = append(manifest.TunnelKeys, slug)
+	}
+	s.mu.Unlock()
+
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return errors.Wrap(err, "marshal reload manifest")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "resolve executable")
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.ExtraFiles = extra
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", reloadEnvKey, raw))
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+
+	return cmd.Start()
+}
+
+func listenerFile(l net.Listener) (*os.File, error) {
+	ul, ok := l.(*net.UnixListener)
+	if !ok {
+		return nil, fmt.Errorf("listener is %T, not a unix listener", l)
+	}
+
+	return ul.File()
+}
+
+// shutdown stops accepting new connections and waits up to drainTimeout,
+// total, for in-flight requests - including GracefulStop draining a live
+// Connect tunnel stream and the supervisor tearing down every service - to
+// finish before giving up and forcing everything closed.
+func (s *Server) shutdown() error {
+	s.events.publish(&proto.Event{
+		Kind:     proto.EventKind_SHUTTING_DOWN,
+		Message:  "draining in-flight requests",
+		UnixNano: time.Now().UnixNano(),
+	})
+
+	close(s.draining)
+	_ = s.listener.Close()
+	s.demux.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	graceful := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(graceful)
+	}()
+
+	select {
+	case <-graceful:
+	case <-ctx.Done():
+		s.grpc.Stop() // force-close whatever's still open, e.g. a live Connect tunnel
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.supervisor.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.drainWG.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return errors.New("shutdown: timed out waiting for in-flight requests to drain")
+	}
+}
+
+// peekedConn replays the bytes route() peeked off conn to decide its
+// protocol before handing the conn to whichever server should read them.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (p *peekedConn) Read(b []byte) (int, error) { return p.r.Read(b) }
+
+// demuxListener is the net.Listener the gRPC server is handed; route()
+// feeds it connections it identifies as gRPC, leaving everything else for
+// the legacy fallback.
+type demuxListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newDemuxListener() *demuxListener {
+	return &demuxListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (d *demuxListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-d.conns:
+		return c, nil
+	case <-d.closed:
+		return nil, errors.New("demux listener closed")
+	}
+}
+
+func (d *demuxListener) Close() error {
+	d.once.Do(func() { close(d.closed) })
+	return nil
+}
+
+func (d *demuxListener) Addr() net.Addr { return streamAddr{} }
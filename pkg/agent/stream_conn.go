@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"net"
+	"time"
+
+	"github.com/superfly/flyctl/pkg/agent/internal/proto"
+)
+
+// connectStream is the subset of proto.AgentService_ConnectClient (and its
+// server-side counterpart) that streamConn needs to move bytes.
+type connectStream interface {
+	Send(*proto.ConnectFrame) error
+	Recv() (*proto.ConnectFrame, error)
+}
+
+// streamConn adapts a Connect RPC's bidirectional stream of ConnectFrames
+// to a net.Conn, so the rest of flyctl can treat a tunneled dial exactly
+// like any other connection.
+type streamConn struct {
+	stream connectStream
+
+	network, addr string
+
+	buf []byte // leftover bytes from the last frame that didn't fit the caller's slice
+}
+
+func newStreamConn(stream connectStream) *streamConn {
+	return &streamConn{stream: stream}
+}
+
+func (c *streamConn) Read(p []byte) (n int, err error) {
+	if len(c.buf) == 0 {
+		var frame *proto.ConnectFrame
+		if frame, err = c.stream.Recv(); err != nil {
+			return
+		}
+
+		if frame.Error != "" {
+			err = mapError(errStreamConn(frame.Error), c.network, c.addr)
+
+			return
+		}
+
+		c.buf = frame.Data
+	}
+
+	n = copy(p, c.buf)
+	c.buf = c.buf[n:]
+
+	return
+}
+
+func (c *streamConn) Write(p []byte) (n int, err error) {
+	if err = c.stream.Send(&proto.ConnectFrame{Data: p}); err != nil {
+		return
+	}
+
+	return len(p), nil
+}
+
+// Close half-closes the stream from our side; the daemon tears down the
+// tunnel dial once it sees the client go away.
+func (c *streamConn) Close() error {
+	type closeSender interface {
+		CloseSend() error
+	}
+
+	if cs, ok := c.stream.(closeSender); ok {
+		return cs.CloseSend()
+	}
+
+	return nil
+}
+
+func (c *streamConn) LocalAddr() net.Addr  { return streamAddr{} }
+func (c *streamConn) RemoteAddr() net.Addr { return streamAddr{} }
+
+// Deadlines are enforced at the RPC/context level rather than per read or
+// write; these are no-ops so streamConn satisfies net.Conn.
+func (c *streamConn) SetDeadline(time.Time) error      { return nil }
+func (c *streamConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *streamConn) SetWriteDeadline(time.Time) error { return nil }
+
+type streamAddr struct{}
+
+func (streamAddr) Network() string { return "agent" }
+func (streamAddr) String() string  { return "tunnel" }
+
+type errStreamConn string
+
+func (e errStreamConn) Error() string { return string(e) }
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Service is a named, independently-restartable subsystem of the agent
+// daemon: the unix listener, a per-org WireGuard tunnel, the DNS resolver,
+// or the health prober behind Probe and WaitForTunnel.
+type Service interface {
+	Name() string
+	Start(ctx context.Context) error
+	Wait() error
+}
+
+// ServiceStatus is a point-in-time snapshot of one supervised service,
+// returned to flyctl by Client.Status.
+type ServiceStatus struct {
+	Name     string
+	Uptime   time.Duration
+	LastErr  error
+	Restarts int
+	Conns    int
+}
+
+// Backoff bounds for restarting a service whose Wait returns a transient
+// error.
+const (
+	restartBackoffMin = time.Second
+	restartBackoffMax = 30 * time.Second
+)
+
+// supervisedService tracks one Service's restart history alongside the
+// service itself.
+type supervisedService struct {
+	Service
+
+	mu        sync.Mutex
+	startedAt time.Time
+	lastErr   error
+	restarts  int
+	backoff   time.Duration
+}
+
+func (s *supervisedService) status() ServiceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := ServiceStatus{Name: s.Name(), LastErr: s.lastErr, Restarts: s.restarts}
+	if !s.startedAt.IsZero() {
+		st.Uptime = time.Since(s.startedAt)
+	}
+
+	return st
+}
+
+// Supervisor starts a set of services in the order they were added,
+// restarts ones that fail with a capped exponential backoff, and drives an
+// orderly shutdown of all of them for the SIGTERM/SIGINT path.
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	services []*supervisedService
+	wg       sync.WaitGroup
+}
+
+func NewSupervisor() *Supervisor {
+	return &Supervisor{}
+}
+
+// Add registers a service to be launched the next time Start is called.
+// Services start in the order they're added, so a dependency (e.g. the
+// listener before anything that accepts on it) should be added first.
+func (sv *Supervisor) Add(svc Service) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	sv.services = append(sv.services, &supervisedService{Service: svc})
+}
+
+// Start launches every registered service, in order, and begins
+// supervising each for restarts.
+func (sv *Supervisor) Start(ctx context.Context) error {
+	sv.ctx, sv.cancel = context.WithCancel(ctx)
+
+	sv.mu.Lock()
+	services := append([]*supervisedService(nil), sv.services...)
+	sv.mu.Unlock()
+
+	for _, s := range services {
+		if err := sv.launch(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sv *Supervisor) launch(s *supervisedService) error {
+	s.mu.Lock()
+	s.startedAt = time.Now()
+	s.mu.Unlock()
+
+	if err := s.Start(sv.ctx); err != nil {
+		return err
+	}
+
+	sv.wg.Add(1)
+	go sv.supervise(s)
+
+	return nil
+}
+
+// supervise waits on one service and, unless the supervisor is shutting
+// down or the service stopped cleanly, restarts it after a backoff that
+// grows on each consecutive failure.
+func (sv *Supervisor) supervise(s *supervisedService) {
+	defer sv.wg.Done()
+
+	err := s.Wait()
+
+	s.mu.Lock()
+	s.lastErr = err
+	s.mu.Unlock()
+
+	if sv.ctx.Err() != nil || err == nil {
+		return // clean stop, or shutdown already underway
+	}
+
+	s.mu.Lock()
+	if s.backoff < restartBackoffMin {
+		s.backoff = restartBackoffMin
+	} else if s.backoff < restartBackoffMax {
+		s.backoff *= 2
+		if s.backoff > restartBackoffMax {
+			s.backoff = restartBackoffMax
+		}
+	}
+	wait := s.backoff
+	s.restarts++
+	s.mu.Unlock()
+
+	select {
+	case <-time.After(wait):
+	case <-sv.ctx.Done():
+		return
+	}
+
+	if err := sv.launch(s); err != nil {
+		s.mu.Lock()
+		s.lastErr = err
+		s.mu.Unlock()
+	}
+}
+
+// Stop cancels every service's context and waits for them to exit.
+func (sv *Supervisor) Stop() {
+	if sv.cancel != nil {
+		sv.cancel()
+	}
+
+	sv.wg.Wait()
+}
+
+// Status returns a snapshot of every supervised service, in start order.
+func (sv *Supervisor) Status() []ServiceStatus {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	out := make([]ServiceStatus, len(sv.services))
+	for i, s := range sv.services {
+		out[i] = s.status()
+	}
+
+	return out
+}